@@ -0,0 +1,26 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package app
+
+import (
+	"context"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func (a *App) GetGroupByRemoteID(remoteID string, source model.GroupSource) (*model.Group, *model.AppError) {
+	result := a.Srv.Store.Group().GroupGetByRemoteID(context.Background(), remoteID, source)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return result.Data.(*model.Group), nil
+}
+
+func (a *App) GetGroupsBySource(source model.GroupSource) ([]*model.Group, *model.AppError) {
+	result := a.Srv.Store.Group().GroupGetAllBySource(context.Background(), source)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return result.Data.([]*model.Group), nil
+}
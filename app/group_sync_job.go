@@ -0,0 +1,210 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package app
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/mattermost/mattermost-server/mlog"
+	"github.com/mattermost/mattermost-server/model"
+)
+
+const (
+	groupSyncJobType    = "group_sync"
+	groupSyncJobDataKey = "last_sync_at"
+
+	// groupSyncChannelMembershipBatchSize bounds how many pending channel memberships are
+	// fetched and applied per page, so a large LDAP-synced deployment can't materialize
+	// hundreds of thousands of rows in a single query.
+	groupSyncChannelMembershipBatchSize = 1000
+)
+
+// GroupSyncJob applies pending group-driven team and channel memberships: users who have been
+// added to a synced group are added to the teams/channels that group is linked to with AutoAdd
+// set, and users who are no longer in any of a channel's AutoAdd groups are removed from channels
+// linked with CanLeave false. Team memberships are only ever added, never removed.
+type GroupSyncJob struct {
+	app *App
+}
+
+func NewGroupSyncJob(a *App) *GroupSyncJob {
+	return &GroupSyncJob{app: a}
+}
+
+// TriggerGroupSync runs a group sync pass immediately, so an admin-facing "Sync Now" action has
+// something to call. Nothing in this package registers groupSyncJobType as a scheduled job on the
+// jobserver, so a pass only runs when this (or GroupSyncJob.Run) is called.
+func (a *App) TriggerGroupSync() *model.AppError {
+	return NewGroupSyncJob(a).Run()
+}
+
+// Run performs a single group sync pass and, once it completes, records the time the pass started
+// for the next run to resume from, so group members added while the pass ran are picked up next time.
+func (j *GroupSyncJob) Run() *model.AppError {
+	lastSyncAt, err := j.lastSyncAt()
+	if err != nil {
+		return err
+	}
+
+	now := model.GetMillis()
+
+	if err := j.syncTeamMemberships(int(lastSyncAt)); err != nil {
+		return err
+	}
+
+	channelMembershipWatermark, err := j.syncChannelMemberships(int(lastSyncAt), now)
+	if err != nil {
+		// Persist only as far as syncChannelMemberships actually got, rather than bumping the
+		// watermark to now: now is later than the pair that failed (and every pair behind it that
+		// was never even fetched), so persisting it here would permanently exclude all of them
+		// from every future run's CreateAt > cursor floor.
+		if setErr := j.setLastSyncAt(channelMembershipWatermark); setErr != nil {
+			mlog.Error("GroupSyncJob failed to persist partial channel membership sync progress", mlog.Err(setErr))
+		}
+		return err
+	}
+
+	if err := j.syncChannelRemovals(); err != nil {
+		return err
+	}
+
+	return j.setLastSyncAt(now)
+}
+
+func (j *GroupSyncJob) syncTeamMemberships(minGroupMembersCreateAt int) *model.AppError {
+	result := j.app.Srv.Store.Group().PendingAutoAddTeamMemberships(context.Background(), minGroupMembersCreateAt)
+	if result.Err != nil {
+		return result.Err
+	}
+
+	for _, pair := range result.Data.([]*model.UserTeamIDPair) {
+		if _, err := j.app.AddTeamMember(pair.TeamId, pair.UserId); err != nil {
+			mlog.Error("GroupSyncJob failed to add team member", mlog.String("team_id", pair.TeamId), mlog.String("user_id", pair.UserId), mlog.Err(err))
+		}
+	}
+
+	return nil
+}
+
+// groupSyncChannelMembershipLogRetries bounds how many attempts (the first one included) this
+// worker makes at logging a ChannelMemberHistory join event for a membership it just created,
+// before giving up and leaving
+// the cursor before that pair so the next run retries it. AddChannelMember is a no-op for an
+// existing member, so replaying a pair whose history log failed is safe, and closes most of the
+// window where a membership ends up with no corresponding history row.
+const groupSyncChannelMembershipLogRetries = 3
+
+// syncChannelMemberships pages through pending channel memberships using a keyset cursor on
+// (GroupMemberCreateAt, UserId, ChannelId), applying and committing progress one page at a time
+// rather than loading everything at once or re-scanning earlier pages with OFFSET. The UserId/
+// ChannelId tie-breaker matters because a bulk LDAP import can stamp many GroupMembers rows with
+// the same CreateAt millisecond; cursoring on CreateAt alone would risk dropping whichever tied
+// rows didn't make the page they first appeared on. It returns the watermark the caller should
+// persist as lastSyncAt: now if every pending pair was synced, or the cursor reached so far if a
+// failure cut the pass short, so a transient error doesn't drop the rest of the sync queue.
+func (j *GroupSyncJob) syncChannelMemberships(minGroupMembersCreateAt int, now int64) (int64, *model.AppError) {
+	cursor := int64(minGroupMembersCreateAt) - 1
+	cursorUserId := ""
+	cursorChannelId := ""
+
+	for {
+		result := j.app.Srv.Store.Group().PendingAutoAddChannelMembershipsPage(context.Background(), cursor, cursorUserId, cursorChannelId, groupSyncChannelMembershipBatchSize)
+		if result.Err != nil {
+			return cursor, result.Err
+		}
+
+		pairs := result.Data.([]*model.UserChannelIDPair)
+		for _, pair := range pairs {
+			if _, err := j.app.AddChannelMember(pair.UserId, pair.ChannelId, ""); err != nil {
+				mlog.Error("GroupSyncJob failed to add channel member", mlog.String("channel_id", pair.ChannelId), mlog.String("user_id", pair.UserId), mlog.Err(err))
+				return cursor, err
+			}
+
+			// AddChannelMember and LogJoinEvent aren't in the same transaction, so a failure here
+			// is retried a few times before giving up. If it still fails, the cursor is left
+			// before this pair rather than advanced past it, so the next run retries the
+			// (idempotent) add together with the history log instead of leaving a membership with
+			// no history row.
+			var logErr *model.AppError
+			for attempt := 0; attempt < groupSyncChannelMembershipLogRetries; attempt++ {
+				if logErr = j.app.Srv.Store.ChannelMemberHistory().LogJoinEvent(pair.UserId, pair.ChannelId, model.GetMillis()); logErr == nil {
+					break
+				}
+			}
+			if logErr != nil {
+				mlog.Error("GroupSyncJob failed to log channel member history join event", mlog.String("channel_id", pair.ChannelId), mlog.String("user_id", pair.UserId), mlog.Err(logErr))
+				return cursor, logErr
+			}
+
+			cursor = pair.GroupMemberCreateAt
+			cursorUserId = pair.UserId
+			cursorChannelId = pair.ChannelId
+		}
+
+		if len(pairs) > 0 {
+			if err := j.setLastSyncAt(cursor); err != nil {
+				return cursor, err
+			}
+		}
+
+		if len(pairs) < groupSyncChannelMembershipBatchSize {
+			return now, nil
+		}
+	}
+}
+
+// groupSyncRemovalReason is recorded against the ChannelMemberHistory row for a group-sync-driven
+// removal so compliance exports can explain why a user disappeared from a channel's membership.
+const groupSyncRemovalReason = "group sync removed"
+
+// syncChannelRemovals removes channel memberships for users who are no longer in any AutoAdd
+// group linked to the channel, on channels linked to a group with CanLeave false, excluding
+// channel admins and manually-added members. Every removal is logged to
+// ChannelMemberHistory with groupSyncRemovalReason so compliance exports capture why the user
+// left.
+func (j *GroupSyncJob) syncChannelRemovals() *model.AppError {
+	result := j.app.Srv.Store.Group().PendingRemoveChannelMemberships(context.Background())
+	if result.Err != nil {
+		return result.Err
+	}
+
+	for _, pair := range result.Data.([]*model.UserChannelIDPair) {
+		if err := j.app.RemoveUserFromChannel(pair.UserId, "", pair.ChannelId); err != nil {
+			mlog.Error("GroupSyncJob failed to remove channel member", mlog.String("channel_id", pair.ChannelId), mlog.String("user_id", pair.UserId), mlog.Err(err))
+			continue
+		}
+		if err := j.app.Srv.Store.ChannelMemberHistory().LogLeaveEvent(pair.UserId, pair.ChannelId, model.GetMillis(), groupSyncRemovalReason); err != nil {
+			mlog.Error("GroupSyncJob failed to log channel member history leave event", mlog.String("channel_id", pair.ChannelId), mlog.String("user_id", pair.UserId), mlog.Err(err))
+		}
+	}
+
+	return nil
+}
+
+// lastSyncAt reads the most recently recorded watermark (the start time of the last complete pass,
+// or the channel membership cursor a later pass had reached), defaulting to 0 (sync everything)
+// the first time the job runs.
+func (j *GroupSyncJob) lastSyncAt() (int64, *model.AppError) {
+	job, err := j.app.Srv.Store.Job().GetNewestJobByStatusAndType(model.JOB_STATUS_SUCCESS, groupSyncJobType)
+	if err != nil || job == nil {
+		return 0, nil
+	}
+
+	at, convErr := strconv.ParseInt(job.Data[groupSyncJobDataKey], 10, 64)
+	if convErr != nil {
+		return 0, nil
+	}
+	return at, nil
+}
+
+func (j *GroupSyncJob) setLastSyncAt(at int64) *model.AppError {
+	job := &model.Job{
+		Type:   groupSyncJobType,
+		Status: model.JOB_STATUS_SUCCESS,
+		Data:   map[string]string{groupSyncJobDataKey: strconv.FormatInt(at, 10)},
+	}
+	_, err := j.app.Srv.Store.Job().Save(job)
+	return err
+}
@@ -0,0 +1,14 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+// ChannelMemberHistoryResult describes one user's presence in a channel for the compliance
+// exporter: when they joined (or were already present, see
+// ChannelMemberHistoryStore.GetUsersInChannelDuring) and, if they've since left, when.
+type ChannelMemberHistoryResult struct {
+	ChannelId string
+	UserId    string
+	JoinTime  int64
+	LeaveTime *int64
+}
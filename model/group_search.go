@@ -0,0 +1,15 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+// GroupSearchOpts carries the filter and pagination criteria accepted by SqlGroupStore.GroupSearch.
+type GroupSearchOpts struct {
+	Q                      string
+	Source                 GroupSource
+	NotAssociatedToTeam    string
+	NotAssociatedToChannel string
+	IncludeMemberCount     bool
+	Page                   int
+	PerPage                int
+}
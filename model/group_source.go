@@ -0,0 +1,26 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+// GroupSource identifies the external system (or absence of one) that owns a Group.
+type GroupSource string
+
+const (
+	GroupSourceLdap   GroupSource = "ldap"
+	GroupSourceSaml   GroupSource = "saml"
+	GroupSourceCustom GroupSource = "custom"
+)
+
+func (gs GroupSource) String() string {
+	return string(gs)
+}
+
+// IsValid returns true if gs is one of the known GroupSource values.
+func (gs GroupSource) IsValid() bool {
+	switch gs {
+	case GroupSourceLdap, GroupSourceSaml, GroupSourceCustom:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+// UserTeamIDPair is a (UserId, TeamId) tuple identifying a pending group-driven team membership.
+type UserTeamIDPair struct {
+	UserId string
+	TeamId string
+}
+
+// UserChannelIDPair is a (UserId, ChannelId) tuple identifying a pending group-driven channel
+// membership. GroupMemberCreateAt is only populated by PendingAutoAddChannelMembershipsPage, where
+// it doubles as the keyset cursor for the next page.
+type UserChannelIDPair struct {
+	UserId              string
+	ChannelId           string
+	GroupMemberCreateAt int64
+}
+
+// GroupChannelPendingMember mirrors a row of the GroupChannelPendingMembers materialization: a
+// user who belongs to a group linked to a channel with AutoAdd, but isn't a member of it yet.
+type GroupChannelPendingMember struct {
+	UserId              string
+	ChannelId           string
+	GroupMemberCreateAt int64
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import "github.com/mattermost/mattermost-server/model"
+
+// ChannelMemberHistoryStore records channel join/leave events independently of the current
+// ChannelMembers row, so that message export and compliance reporting can reconstruct who was in a
+// channel at a given point in time even after a membership is removed.
+type ChannelMemberHistoryStore interface {
+	LogJoinEvent(userId string, channelId string, joinTime int64) *model.AppError
+	LogLeaveEvent(userId string, channelId string, leaveTime int64, reason string) *model.AppError
+
+	// GetUsersInChannelDuring returns the users present in a channel between startTime and
+	// endTime, for the compliance exporter. Implementations must fall back to the current
+	// ChannelMembers row for a user when no ChannelMemberHistory join row exists for them: group
+	// sync auto-adds a user to a channel without ever writing a join history row for memberships
+	// that predate this store (or any other channel join path that skipped history logging), so a
+	// history-only query would silently omit them from the export even though they were present.
+	GetUsersInChannelDuring(startTime int64, endTime int64, channelId string) ([]*model.ChannelMemberHistoryResult, *model.AppError)
+}
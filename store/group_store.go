@@ -0,0 +1,39 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"context"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// GroupStore exposes the persistence operations for groups and their membership, independent
+// of which LayeredStoreSupplier in the chain ultimately services a given call. Group, member and
+// syncable methods are prefixed with Group (GroupCreate, GroupGet, ...) to match the naming SqlSupplier already uses
+// for this table, rather than the bare CRUD names other stores in this chain sometimes use.
+type GroupStore interface {
+	GroupCreate(ctx context.Context, group *model.Group) *LayeredStoreSupplierResult
+	GroupGet(ctx context.Context, groupId string) *LayeredStoreSupplierResult
+	GroupGetByRemoteID(ctx context.Context, remoteID string, source model.GroupSource) *LayeredStoreSupplierResult
+	GroupGetAllPage(ctx context.Context, offset int, limit int) *LayeredStoreSupplierResult
+	GroupGetAllBySource(ctx context.Context, source model.GroupSource) *LayeredStoreSupplierResult
+	GroupSearch(ctx context.Context, opts model.GroupSearchOpts) *LayeredStoreSupplierResult
+	GroupUpdate(ctx context.Context, group *model.Group) *LayeredStoreSupplierResult
+	GroupDelete(ctx context.Context, groupID string) *LayeredStoreSupplierResult
+
+	GroupCreateMember(ctx context.Context, groupID string, userID string) *LayeredStoreSupplierResult
+	GroupDeleteMember(ctx context.Context, groupID string, userID string) *LayeredStoreSupplierResult
+
+	GroupCreateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable) *LayeredStoreSupplierResult
+	GroupGetGroupSyncable(ctx context.Context, groupID string, syncableID string, syncableType model.GroupSyncableType) *LayeredStoreSupplierResult
+	GroupGetAllGroupSyncablesByGroupPage(ctx context.Context, groupID string, syncableType model.GroupSyncableType, offset int, limit int) *LayeredStoreSupplierResult
+	GroupUpdateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable) *LayeredStoreSupplierResult
+	GroupDeleteGroupSyncable(ctx context.Context, groupID string, syncableID string, syncableType model.GroupSyncableType) *LayeredStoreSupplierResult
+
+	PendingAutoAddTeamMemberships(ctx context.Context, minGroupMembersCreateAt int) *LayeredStoreSupplierResult
+	PendingAutoAddChannelMemberships(ctx context.Context, minGroupMembersCreateAt int) *LayeredStoreSupplierResult
+	PendingAutoAddChannelMembershipsPage(ctx context.Context, afterCreateAt int64, afterUserId string, afterChannelId string, limit int) *LayeredStoreSupplierResult
+	PendingRemoveChannelMemberships(ctx context.Context) *LayeredStoreSupplierResult
+}
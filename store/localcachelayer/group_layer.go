@@ -0,0 +1,263 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package localcachelayer
+
+import (
+	"context"
+	"fmt"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/mattermost/mattermost-server/einterfaces"
+	"github.com/mattermost/mattermost-server/model"
+	"github.com/mattermost/mattermost-server/store"
+)
+
+const (
+	groupCacheSize         = 5000
+	groupSyncableCacheSize = 5000
+	groupsPageCacheSize    = 200
+)
+
+// LocalCacheGroupStore sits above a GroupStore supplier in the LayeredStore chain and serves
+// GroupGet/GroupGetGroupSyncable/GroupGetAllPage out of an in-process LRU, since those are read on
+// every permission and membership check in the auto-add pipeline.
+type LocalCacheGroupStore struct {
+	store.GroupStore
+	rootStore          *LocalCacheStore
+	groupCache         *lru.Cache
+	groupSyncableCache *lru.Cache
+	groupsPageCache    *lru.Cache
+}
+
+// LocalCacheStore carries the shared cluster interface that invalidation messages are broadcast
+// over, so every cache in the LayeredStore chain stays consistent in an HA deployment.
+type LocalCacheStore struct {
+	cluster einterfaces.ClusterInterface
+	metrics einterfaces.MetricsInterface
+}
+
+func NewLocalCacheGroupStore(next store.GroupStore, root *LocalCacheStore) *LocalCacheGroupStore {
+	groupCache, _ := lru.New(groupCacheSize)
+	groupSyncableCache, _ := lru.New(groupSyncableCacheSize)
+	groupsPageCache, _ := lru.New(groupsPageCacheSize)
+
+	s := &LocalCacheGroupStore{
+		GroupStore:         next,
+		rootStore:          root,
+		groupCache:         groupCache,
+		groupSyncableCache: groupSyncableCache,
+		groupsPageCache:    groupsPageCache,
+	}
+
+	if root.cluster != nil {
+		root.cluster.RegisterClusterMessageHandler(model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_GROUP, s.handleClusterInvalidateGroup)
+		root.cluster.RegisterClusterMessageHandler(model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_GROUP_SYNCABLE, s.handleClusterInvalidateGroupSyncable)
+		root.cluster.RegisterClusterMessageHandler(model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_GROUPS, s.handleClusterInvalidateGroupsPage)
+	}
+
+	return s
+}
+
+// NewLocalCacheLayer wraps a GroupStore supplier (typically the SqlSupplier at the bottom of the
+// chain) with LocalCacheGroupStore, so callers constructing the store chain get group caching
+// without reaching into this package's internals. It's the entry point the rest of the series'
+// store-chain wiring was missing: LocalCacheGroupStore existed but nothing called it.
+func NewLocalCacheLayer(next store.GroupStore, cluster einterfaces.ClusterInterface, metrics einterfaces.MetricsInterface) store.GroupStore {
+	return NewLocalCacheGroupStore(next, &LocalCacheStore{cluster: cluster, metrics: metrics})
+}
+
+func groupSyncableCacheKey(groupID, syncableID string, syncableType model.GroupSyncableType) string {
+	return fmt.Sprintf("%s:%s:%s", groupID, syncableID, syncableType.String())
+}
+
+func (s *LocalCacheGroupStore) recordHit(family string) {
+	if s.rootStore.metrics != nil {
+		s.rootStore.metrics.IncrementMemCacheHitCounter(family)
+	}
+}
+
+func (s *LocalCacheGroupStore) recordMiss(family string) {
+	if s.rootStore.metrics != nil {
+		s.rootStore.metrics.IncrementMemCacheMissCounter(family)
+	}
+}
+
+func (s *LocalCacheGroupStore) GroupGet(ctx context.Context, groupID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	if cached, ok := s.groupCache.Get(groupID); ok {
+		s.recordHit("Group")
+		result := store.NewSupplierResult()
+		result.Data = cached.(*model.Group)
+		return result
+	}
+	s.recordMiss("Group")
+
+	result := s.GroupStore.GroupGet(ctx, groupID, hints...)
+	if result.Err == nil {
+		s.groupCache.Add(groupID, result.Data)
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupGetGroupSyncable(ctx context.Context, groupID string, syncableID string, syncableType model.GroupSyncableType, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	key := groupSyncableCacheKey(groupID, syncableID, syncableType)
+	if cached, ok := s.groupSyncableCache.Get(key); ok {
+		s.recordHit("GroupSyncable")
+		result := store.NewSupplierResult()
+		result.Data = cached.(*model.GroupSyncable)
+		return result
+	}
+	s.recordMiss("GroupSyncable")
+
+	result := s.GroupStore.GroupGetGroupSyncable(ctx, groupID, syncableID, syncableType, hints...)
+	if result.Err == nil {
+		s.groupSyncableCache.Add(key, result.Data)
+	}
+	return result
+}
+
+func groupsPageCacheKey(offset, limit int) string {
+	return fmt.Sprintf("%d:%d", offset, limit)
+}
+
+func (s *LocalCacheGroupStore) GroupGetAllPage(ctx context.Context, offset int, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	key := groupsPageCacheKey(offset, limit)
+	if cached, ok := s.groupsPageCache.Get(key); ok {
+		s.recordHit("GroupsPage")
+		result := store.NewSupplierResult()
+		result.Data = cached.([]*model.Group)
+		return result
+	}
+	s.recordMiss("GroupsPage")
+
+	result := s.GroupStore.GroupGetAllPage(ctx, offset, limit, hints...)
+	if result.Err == nil {
+		s.groupsPageCache.Add(key, result.Data)
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) invalidateGroup(groupID string) {
+	s.groupCache.Remove(groupID)
+}
+
+func (s *LocalCacheGroupStore) invalidateGroupSyncable(groupID, syncableID string, syncableType model.GroupSyncableType) {
+	s.groupSyncableCache.Remove(groupSyncableCacheKey(groupID, syncableID, syncableType))
+}
+
+// invalidateGroupsPage purges the whole page cache rather than a single key, since a group
+// creation/update/deletion can shift every page's contents (ORDER BY CreateAt DESC).
+func (s *LocalCacheGroupStore) invalidateGroupsPage() {
+	s.groupsPageCache.Purge()
+}
+
+func (s *LocalCacheGroupStore) broadcastGroupInvalidation(groupID string) {
+	s.invalidateGroup(groupID)
+	if s.rootStore.cluster != nil {
+		s.rootStore.cluster.SendClusterMessage(&model.ClusterMessage{
+			Event:    model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_GROUP,
+			SendType: model.CLUSTER_SEND_BEST_EFFORT,
+			Data:     groupID,
+		})
+	}
+}
+
+func (s *LocalCacheGroupStore) broadcastGroupSyncableInvalidation(groupID, syncableID string, syncableType model.GroupSyncableType) {
+	s.invalidateGroupSyncable(groupID, syncableID, syncableType)
+	if s.rootStore.cluster != nil {
+		s.rootStore.cluster.SendClusterMessage(&model.ClusterMessage{
+			Event:    model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_GROUP_SYNCABLE,
+			SendType: model.CLUSTER_SEND_BEST_EFFORT,
+			Data:     groupSyncableCacheKey(groupID, syncableID, syncableType),
+		})
+	}
+}
+
+func (s *LocalCacheGroupStore) broadcastGroupsPageInvalidation() {
+	s.invalidateGroupsPage()
+	if s.rootStore.cluster != nil {
+		s.rootStore.cluster.SendClusterMessage(&model.ClusterMessage{
+			Event:    model.CLUSTER_EVENT_INVALIDATE_CACHE_FOR_GROUPS,
+			SendType: model.CLUSTER_SEND_BEST_EFFORT,
+		})
+	}
+}
+
+func (s *LocalCacheGroupStore) handleClusterInvalidateGroup(msg *model.ClusterMessage) {
+	s.invalidateGroup(msg.Data)
+}
+
+func (s *LocalCacheGroupStore) handleClusterInvalidateGroupSyncable(msg *model.ClusterMessage) {
+	s.groupSyncableCache.Remove(msg.Data)
+}
+
+func (s *LocalCacheGroupStore) handleClusterInvalidateGroupsPage(msg *model.ClusterMessage) {
+	s.invalidateGroupsPage()
+}
+
+func (s *LocalCacheGroupStore) GroupCreate(ctx context.Context, group *model.Group, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupCreate(ctx, group, hints...)
+	if result.Err == nil {
+		s.broadcastGroupsPageInvalidation()
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupUpdate(ctx context.Context, group *model.Group, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupUpdate(ctx, group, hints...)
+	if result.Err == nil {
+		s.broadcastGroupInvalidation(group.Id)
+		s.broadcastGroupsPageInvalidation()
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupDelete(ctx context.Context, groupID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupDelete(ctx, groupID, hints...)
+	if result.Err == nil {
+		s.broadcastGroupInvalidation(groupID)
+		s.broadcastGroupsPageInvalidation()
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupCreateMember(ctx context.Context, groupID string, userID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupCreateMember(ctx, groupID, userID, hints...)
+	if result.Err == nil {
+		s.broadcastGroupInvalidation(groupID)
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupDeleteMember(ctx context.Context, groupID string, userID string, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupDeleteMember(ctx, groupID, userID, hints...)
+	if result.Err == nil {
+		s.broadcastGroupInvalidation(groupID)
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupCreateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupCreateGroupSyncable(ctx, groupSyncable, hints...)
+	if result.Err == nil {
+		s.broadcastGroupSyncableInvalidation(groupSyncable.GroupId, groupSyncable.SyncableId, groupSyncable.Type)
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupUpdateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupUpdateGroupSyncable(ctx, groupSyncable, hints...)
+	if result.Err == nil {
+		s.broadcastGroupSyncableInvalidation(groupSyncable.GroupId, groupSyncable.SyncableId, groupSyncable.Type)
+	}
+	return result
+}
+
+func (s *LocalCacheGroupStore) GroupDeleteGroupSyncable(ctx context.Context, groupID string, syncableID string, syncableType model.GroupSyncableType, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := s.GroupStore.GroupDeleteGroupSyncable(ctx, groupID, syncableID, syncableType, hints...)
+	if result.Err == nil {
+		s.broadcastGroupSyncableInvalidation(groupID, syncableID, syncableType)
+	}
+	return result
+}
@@ -8,6 +8,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/mattermost/gorp"
 	"github.com/mattermost/mattermost-server/model"
@@ -40,7 +41,23 @@ func initSqlSupplierGroups(sqlStore SqlStore) {
 		groupChannels.ColMap("GroupId").SetMaxSize(26)
 		groupChannels.ColMap("SyncableId").Rename("ChannelId")
 		groupChannels.ColMap("SyncableId").SetMaxSize(26)
+
+		groupChannelPendingMembers := db.AddTableWithName(model.GroupChannelPendingMember{}, "GroupChannelPendingMembers").SetKeys(false, "UserId", "ChannelId")
+		groupChannelPendingMembers.ColMap("UserId").SetMaxSize(26)
+		groupChannelPendingMembers.ColMap("ChannelId").SetMaxSize(26)
 	}
+
+	sqlStore.CreateUniqueCompositeIndexIfNotExists("idx_groups_remoteid_type", "Groups", []string{"RemoteId", "Type"})
+
+	// The table above and the triggers below are provisioned unconditionally, regardless of
+	// groupChannelPendingMembersEnabled(), so EnableExperimentalGroupChannelPendingMembers can be
+	// flipped at runtime without ever hitting a missing table or trigger.
+	upgradeGroupChannelPendingMembersTriggers(sqlStore)
+
+	// ManuallyAdded distinguishes a channel membership a user (or admin) created directly from one
+	// group sync created on their behalf, so PendingRemoveChannelMemberships never auto-removes a
+	// manually-added member just because they aren't in one of the channel's AutoAdd groups.
+	upgradeChannelMembersManuallyAdded(sqlStore)
 }
 
 func (s *SqlSupplier) GroupCreate(ctx context.Context, group *model.Group, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
@@ -125,6 +142,94 @@ func (s *SqlSupplier) GroupGetAllPage(ctx context.Context, offset int, limit int
 	return result
 }
 
+func (s *SqlSupplier) GroupGetByRemoteID(ctx context.Context, remoteID string, source model.GroupSource, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var group *model.Group
+	if err := s.GetReplica().SelectOne(&group, "SELECT * FROM Groups WHERE RemoteId = :RemoteId AND Type = :Type AND DeleteAt = 0", map[string]interface{}{"RemoteId": remoteID, "Type": source}); err != nil {
+		if err == sql.ErrNoRows {
+			result.Err = model.NewAppError("SqlGroupStore.GetByRemoteID", "store.sql_group.get_by_remote_id.no_rows", nil, "remote_id="+remoteID+", "+err.Error(), http.StatusNotFound)
+		} else {
+			result.Err = model.NewAppError("SqlGroupStore.GetByRemoteID", "store.sql_group.get_by_remote_id.select_error", nil, "remote_id="+remoteID+", "+err.Error(), http.StatusInternalServerError)
+		}
+		return result
+	}
+
+	result.Data = group
+	return result
+}
+
+func (s *SqlSupplier) GroupGetAllBySource(ctx context.Context, source model.GroupSource, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	var groups []*model.Group
+	if _, err := s.GetReplica().Select(&groups, "SELECT * FROM Groups WHERE Type = :Type AND DeleteAt = 0 ORDER BY DisplayName", map[string]interface{}{"Type": source}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.GetAllBySource", "store.sql_group.get_all_by_source.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = groups
+	return result
+}
+
+// GroupSearch returns a page of groups matching the given criteria, suitable for powering an
+// admin-facing group picker without requiring callers to fetch every page and filter client-side.
+func (s *SqlSupplier) GroupSearch(ctx context.Context, opts model.GroupSearchOpts, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	selectStr := "Groups.*"
+	joinStr := ""
+	whereClauses := []string{"Groups.DeleteAt = 0"}
+	params := map[string]interface{}{
+		"Limit":  opts.PerPage,
+		"Offset": opts.Page * opts.PerPage,
+	}
+
+	if opts.Q != "" {
+		whereClauses = append(whereClauses, "(LOWER(Groups.Name) LIKE LOWER(:Q) ESCAPE '*' OR LOWER(Groups.DisplayName) LIKE LOWER(:Q) ESCAPE '*')")
+		params["Q"] = "%" + sanitizeLikeTerm(opts.Q) + "%"
+	}
+
+	if opts.Source != "" {
+		whereClauses = append(whereClauses, "Groups.Type = :Source")
+		params["Source"] = opts.Source
+	}
+
+	if opts.IncludeMemberCount {
+		selectStr += ", COALESCE(MemberCounts.MemberCount, 0) AS MemberCount"
+		joinStr += " LEFT JOIN (SELECT GroupId, COUNT(*) AS MemberCount FROM GroupMembers WHERE DeleteAt = 0 GROUP BY GroupId) AS MemberCounts ON MemberCounts.GroupId = Groups.Id"
+	}
+
+	if opts.NotAssociatedToTeam != "" {
+		whereClauses = append(whereClauses, "NOT EXISTS (SELECT 1 FROM GroupTeams WHERE GroupTeams.GroupId = Groups.Id AND GroupTeams.TeamId = :NotAssociatedToTeam AND GroupTeams.DeleteAt = 0)")
+		params["NotAssociatedToTeam"] = opts.NotAssociatedToTeam
+	}
+
+	if opts.NotAssociatedToChannel != "" {
+		whereClauses = append(whereClauses, "NOT EXISTS (SELECT 1 FROM GroupChannels WHERE GroupChannels.GroupId = Groups.Id AND GroupChannels.ChannelId = :NotAssociatedToChannel AND GroupChannels.DeleteAt = 0)")
+		params["NotAssociatedToChannel"] = opts.NotAssociatedToChannel
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM Groups%s WHERE %s ORDER BY Groups.DisplayName ASC LIMIT :Limit OFFSET :Offset",
+		selectStr, joinStr, strings.Join(whereClauses, " AND "))
+
+	var groups []*model.Group
+	if _, err := s.GetReplica().Select(&groups, query, params); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.GroupSearch", "store.sql_group.search.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = groups
+	return result
+}
+
+// sanitizeLikeTerm escapes the wildcard characters recognized by the ESCAPE '*' clause above so
+// that user-supplied search terms can't be used to widen a LIKE match.
+func sanitizeLikeTerm(term string) string {
+	replacer := strings.NewReplacer("*", "**", "%", "*%", "_", "*_")
+	return replacer.Replace(term)
+}
+
 func (s *SqlSupplier) GroupUpdate(ctx context.Context, group *model.Group, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
@@ -276,6 +381,19 @@ func (s *SqlSupplier) GroupDeleteMember(ctx context.Context, groupID string, use
 	return result
 }
 
+// groupSyncableTableName returns the physical table backing a GroupSyncable of the given type,
+// drawn from a fixed whitelist so callers can never interpolate an arbitrary identifier into SQL.
+func groupSyncableTableName(syncableType model.GroupSyncableType) (string, error) {
+	switch syncableType {
+	case model.GSTeam:
+		return "GroupTeams", nil
+	case model.GSChannel:
+		return "GroupChannels", nil
+	default:
+		return "", fmt.Errorf("unsupported GroupSyncableType: %v", syncableType)
+	}
+}
+
 func (s *SqlSupplier) GroupCreateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
@@ -284,34 +402,54 @@ func (s *SqlSupplier) GroupCreateGroupSyncable(ctx context.Context, groupSyncabl
 		return result
 	}
 
+	table, err := groupSyncableTableName(groupSyncable.Type)
+	if err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.invalid_syncable_type", nil, err.Error(), http.StatusBadRequest)
+		return result
+	}
+
 	// Reset values that shouldn't be updatable by parameter
 	groupSyncable.DeleteAt = 0
 	groupSyncable.CreateAt = model.GetMillis()
 	groupSyncable.UpdateAt = groupSyncable.CreateAt
 
-	insertStmt := fmt.Sprintf("INSERT INTO Group%ss (GroupId, %sId, CanLeave, AutoAdd, CreateAt, UpdateAt, DeleteAt) VALUES ('%s', '%s', %t, %t, %d, %d, %d)",
-		groupSyncable.Type.String(),
+	transaction, tErr := s.GetMaster().Begin()
+	if tErr != nil {
+		result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	insertStmt := fmt.Sprintf("INSERT INTO %s (GroupId, %sId, CanLeave, AutoAdd, CreateAt, UpdateAt, DeleteAt) VALUES (:GroupId, :SyncableId, :CanLeave, :AutoAdd, :CreateAt, :UpdateAt, :DeleteAt)",
+		table,
 		groupSyncable.Type.String(),
-		groupSyncable.GroupId,
-		groupSyncable.SyncableId,
-		groupSyncable.CanLeave,
-		groupSyncable.AutoAdd,
-		groupSyncable.CreateAt,
-		groupSyncable.UpdateAt,
-		groupSyncable.DeleteAt,
 	)
 
-	sqlResult, err := s.GetMaster().Exec(insertStmt)
+	sqlResult, err := transaction.Exec(insertStmt, map[string]interface{}{
+		"GroupId":    groupSyncable.GroupId,
+		"SyncableId": groupSyncable.SyncableId,
+		"CanLeave":   groupSyncable.CanLeave,
+		"AutoAdd":    groupSyncable.AutoAdd,
+		"CreateAt":   groupSyncable.CreateAt,
+		"UpdateAt":   groupSyncable.UpdateAt,
+		"DeleteAt":   groupSyncable.DeleteAt,
+	})
 	if err != nil {
+		transaction.Rollback()
 		result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.insert_error", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId+", "+err.Error(), http.StatusInternalServerError)
 		return result
 	}
 
 	if rowsAffected, _ := sqlResult.RowsAffected(); rowsAffected == 0 {
+		transaction.Rollback()
 		result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.no_rows_affected", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
 		return result
 	}
 
+	if err := transaction.Commit(); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.CreateGroupSyncable", "store.sql_group.create_group_syncable.commit_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
 	result.Data = groupSyncable
 	return result
 }
@@ -387,10 +525,23 @@ func (s *SqlSupplier) GroupGetAllGroupSyncablesByGroupPage(ctx context.Context,
 func (s *SqlSupplier) GroupUpdateGroupSyncable(ctx context.Context, groupSyncable *model.GroupSyncable, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	selectQuery := fmt.Sprintf("SELECT * from Group%[1]ss WHERE GroupId = :GroupId AND %[1]sId = :SyncableId", groupSyncable.Type.String())
+	table, err := groupSyncableTableName(groupSyncable.Type)
+	if err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.invalid_syncable_type", nil, err.Error(), http.StatusBadRequest)
+		return result
+	}
+
+	transaction, tErr := s.GetMaster().Begin()
+	if tErr != nil {
+		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	selectQuery := fmt.Sprintf("SELECT * FROM %s WHERE GroupId = :GroupId AND %sId = :SyncableId", table, groupSyncable.Type.String())
 
 	var retrievedGroupSyncable *model.GroupSyncable
-	if err := s.GetMaster().SelectOne(&retrievedGroupSyncable, selectQuery, map[string]interface{}{"GroupId": groupSyncable.GroupId, "SyncableId": groupSyncable.SyncableId}); err != nil {
+	if err := transaction.SelectOne(&retrievedGroupSyncable, selectQuery, map[string]interface{}{"GroupId": groupSyncable.GroupId, "SyncableId": groupSyncable.SyncableId}); err != nil {
+		transaction.Rollback()
 		if err == sql.ErrNoRows {
 			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_rows", nil, err.Error(), http.StatusInternalServerError)
 			return result
@@ -400,12 +551,14 @@ func (s *SqlSupplier) GroupUpdateGroupSyncable(ctx context.Context, groupSyncabl
 	}
 
 	if err := groupSyncable.IsValid(); err != nil {
+		transaction.Rollback()
 		result.Err = err
 		return result
 	}
 
 	// Check if no update is required
 	if (retrievedGroupSyncable.AutoAdd == groupSyncable.AutoAdd) && (retrievedGroupSyncable.CanLeave == groupSyncable.CanLeave) {
+		transaction.Rollback()
 		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_change", nil, "group_id="+groupSyncable.GroupId+", syncable_id="+groupSyncable.SyncableId, http.StatusInternalServerError)
 		return result
 	}
@@ -418,19 +571,22 @@ func (s *SqlSupplier) GroupUpdateGroupSyncable(ctx context.Context, groupSyncabl
 	groupSyncable.CreateAt = retrievedGroupSyncable.CreateAt
 	groupSyncable.UpdateAt = model.GetMillis()
 
-	updateStmt := fmt.Sprintf("UPDATE Group%ss SET CanLeave = %t, AutoAdd = %t, UpdateAt = %d",
-		groupSyncable.Type.String(),
-		groupSyncable.CanLeave,
-		groupSyncable.AutoAdd,
-		groupSyncable.UpdateAt,
-	)
+	updateStmt := fmt.Sprintf("UPDATE %s SET CanLeave = :CanLeave, AutoAdd = :AutoAdd, UpdateAt = :UpdateAt WHERE GroupId = :GroupId AND %sId = :SyncableId", table, groupSyncable.Type.String())
 
-	if _, err := s.GetMaster().Exec(updateStmt); err != nil {
-		if err == sql.ErrNoRows {
-			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.no_rows", nil, "GroupId="+groupSyncable.GroupId+", SyncableId="+groupSyncable.SyncableId+", SyncableType="+groupSyncable.Type.String()+", "+err.Error(), http.StatusInternalServerError)
-		} else {
-			result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.update_error", nil, err.Error(), http.StatusInternalServerError)
-		}
+	if _, err := transaction.Exec(updateStmt, map[string]interface{}{
+		"CanLeave":   groupSyncable.CanLeave,
+		"AutoAdd":    groupSyncable.AutoAdd,
+		"UpdateAt":   groupSyncable.UpdateAt,
+		"GroupId":    groupSyncable.GroupId,
+		"SyncableId": groupSyncable.SyncableId,
+	}); err != nil {
+		transaction.Rollback()
+		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.update_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	if err := transaction.Commit(); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.UpdateGroupSyncable", "store.sql_group.update_group_syncable.commit_error", nil, err.Error(), http.StatusInternalServerError)
 		return result
 	}
 
@@ -451,10 +607,23 @@ func (s *SqlSupplier) GroupDeleteGroupSyncable(ctx context.Context, groupID stri
 		return result
 	}
 
-	selectQuery := fmt.Sprintf("SELECT * from Group%[1]ss WHERE GroupId = :GroupId AND %[1]sId = :SyncableId", syncableType.String())
+	table, tableErr := groupSyncableTableName(syncableType)
+	if tableErr != nil {
+		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.invalid_syncable_type", nil, tableErr.Error(), http.StatusBadRequest)
+		return result
+	}
+
+	transaction, tErr := s.GetMaster().Begin()
+	if tErr != nil {
+		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.begin_transaction_error", nil, tErr.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	selectQuery := fmt.Sprintf("SELECT * FROM %s WHERE GroupId = :GroupId AND %sId = :SyncableId", table, syncableType.String())
 
 	var groupSyncable *model.GroupSyncable
-	if err := s.GetReplica().SelectOne(&groupSyncable, selectQuery, map[string]interface{}{"GroupId": groupID, "SyncableId": syncableID}); err != nil {
+	if err := transaction.SelectOne(&groupSyncable, selectQuery, map[string]interface{}{"GroupId": groupID, "SyncableId": syncableID}); err != nil {
+		transaction.Rollback()
 		if err == sql.ErrNoRows {
 			result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.no_rows", nil, "Id="+groupID+", "+err.Error(), http.StatusNotFound)
 		} else {
@@ -464,6 +633,7 @@ func (s *SqlSupplier) GroupDeleteGroupSyncable(ctx context.Context, groupID stri
 	}
 
 	if groupSyncable.DeleteAt != 0 {
+		transaction.Rollback()
 		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.already_deleted", nil, "group_id="+groupID+"syncable_id="+syncableID, http.StatusBadRequest)
 		return result
 	}
@@ -476,26 +646,31 @@ func (s *SqlSupplier) GroupDeleteGroupSyncable(ctx context.Context, groupID stri
 	groupSyncable.DeleteAt = time
 	groupSyncable.UpdateAt = time
 
-	updateQuery := fmt.Sprintf("UPDATE Group%ss SET DeleteAt = %d, UpdateAt = %d WHERE GroupId = '%s' AND %sId = '%s'",
-		groupSyncable.Type.String(),
-		groupSyncable.DeleteAt,
-		groupSyncable.UpdateAt,
-		groupSyncable.GroupId,
-		groupSyncable.Type.String(),
-		groupSyncable.SyncableId,
-	)
+	updateQuery := fmt.Sprintf("UPDATE %s SET DeleteAt = :DeleteAt, UpdateAt = :UpdateAt WHERE GroupId = :GroupId AND %sId = :SyncableId", table, groupSyncable.Type.String())
 
-	sqlResult, err := s.GetMaster().Exec(updateQuery)
+	sqlResult, err := transaction.Exec(updateQuery, map[string]interface{}{
+		"DeleteAt":   groupSyncable.DeleteAt,
+		"UpdateAt":   groupSyncable.UpdateAt,
+		"GroupId":    groupSyncable.GroupId,
+		"SyncableId": groupSyncable.SyncableId,
+	})
 	if err != nil {
+		transaction.Rollback()
 		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.update_error", nil, err.Error(), http.StatusInternalServerError)
 		return result
 	}
 
 	if rowsAffected, _ := sqlResult.RowsAffected(); rowsAffected == 0 {
+		transaction.Rollback()
 		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.no_rows_affected", nil, "", http.StatusInternalServerError)
 		return result
 	}
 
+	if err := transaction.Commit(); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.DeleteGroupSyncable", "store.sql_group.delete_group_syncable.commit_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
 	result.Data = groupSyncable
 
 	return result
@@ -508,7 +683,7 @@ func (s *SqlSupplier) GroupDeleteGroupSyncable(ctx context.Context, groupID stri
 func (s *SqlSupplier) PendingAutoAddTeamMemberships(ctx context.Context, minGroupMembersCreateAt int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
-	sql := `SELECT GroupMembers.UserId, GroupTeams.SyncableId
+	sql := `SELECT GroupMembers.UserId, GroupTeams.SyncableId AS TeamId
 			FROM GroupMembers
 			JOIN GroupTeams ON GroupTeams.GroupId = GroupMembers.GroupId
 			JOIN Groups ON Groups.Id = GroupMembers.GroupId
@@ -520,21 +695,32 @@ func (s *SqlSupplier) PendingAutoAddTeamMemberships(ctx context.Context, minGrou
 			AND GroupMembers.DeleteAt = 0
 			AND GroupMembers.CreateAt >= :MinGroupMembersCreateAt`
 
-	sqlResult, err := s.GetMaster().Exec(sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt})
-	if err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddTeamMemberships", "store.sql_group.select_error", nil, "", http.StatusInternalServerError)
+	var pairs []*model.UserTeamIDPair
+	if _, err := s.GetMaster().Select(&pairs, sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddTeamMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
 	}
 
-	result.Data = sqlResult
+	result.Data = pairs
 
 	return result
 }
 
-// PendingAutoAddChannelMemberships returns a slice [UserIds, ChannelIds] tuples that need newly created
-// memberships as configured by groups.
+// PendingAutoAddChannelMemberships returns a slice of (UserId, ChannelId) tuples that need newly
+// created memberships as configured by groups.
 //
 // Typically minGroupMembersCreateAt will be the last successful group sync time.
-func (s *SqlSupplier) PendingAutoAddChannelMemberships(minGroupMembersCreateAt int) *store.LayeredStoreSupplierResult {
+func (s *SqlSupplier) PendingAutoAddChannelMemberships(ctx context.Context, minGroupMembersCreateAt int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	if groupChannelPendingMembersEnabled() {
+		return s.pendingAutoAddChannelMembershipsMaterialized(minGroupMembersCreateAt)
+	}
+	return s.pendingAutoAddChannelMembershipsJoin(minGroupMembersCreateAt)
+}
+
+// pendingAutoAddChannelMembershipsJoin is the original seven-table FULL JOIN query. It remains the
+// default until the GroupChannelPendingMembers materialization (see upgrade_group.go) has proven
+// itself, and is the fallback operators can revert to with EnableExperimentalGroupChannelPendingMembers(false).
+func (s *SqlSupplier) pendingAutoAddChannelMembershipsJoin(minGroupMembersCreateAt int) *store.LayeredStoreSupplierResult {
 	result := store.NewSupplierResult()
 
 	sql := `SELECT GroupMembers.UserId, GroupChannels.ChannelId
@@ -553,12 +739,133 @@ func (s *SqlSupplier) PendingAutoAddChannelMemberships(minGroupMembersCreateAt i
 			AND GroupMembers.DeleteAt = 0
 			AND GroupMembers.CreateAt >= :MinGroupMembersCreateAt`
 
-	sqlResult, err := s.GetMaster().Exec(sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt})
-	if err != nil {
-		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddChannelMemberships", "store.sql_group.select_error", nil, "", http.StatusInternalServerError)
+	var pairs []*model.UserChannelIDPair
+	if _, err := s.GetMaster().Select(&pairs, sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddChannelMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
 	}
 
-	result.Data = sqlResult
+	result.Data = pairs
+
+	return result
+}
+
+// PendingAutoAddChannelMembershipsPage is the batched counterpart to PendingAutoAddChannelMemberships.
+// Paging is a keyset cursor on (GroupMembers.CreateAt, UserId, ChannelId) rather than LIMIT/OFFSET:
+// an OFFSET over this FULL JOIN would recompute the whole join on every page, and CreateAt alone
+// isn't unique enough to cursor on safely — a bulk LDAP import can stamp more GroupMembers rows
+// with the same millisecond than fit in one page, and a single-column cursor would permanently
+// drop whichever of those tied rows didn't make the page they first appeared on. The row-value
+// comparison breaks ties deterministically by (UserId, ChannelId) instead. Callers should pass
+// afterCreateAt/afterUserId/afterChannelId as the GroupMemberCreateAt/UserId/ChannelId of the last
+// row returned by the previous page (or one less than the sync floor and empty strings for the
+// first page), and stop paging once fewer than limit rows come back.
+func (s *SqlSupplier) PendingAutoAddChannelMembershipsPage(ctx context.Context, afterCreateAt int64, afterUserId string, afterChannelId string, limit int, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	sql := `SELECT GroupMembers.UserId, GroupChannels.ChannelId, GroupMembers.CreateAt AS GroupMemberCreateAt
+			FROM GroupMembers
+			JOIN GroupChannels ON GroupChannels.GroupId = GroupMembers.GroupId
+			JOIN Groups ON Groups.Id = GroupMembers.GroupId
+			JOIN Channels ON Channels.Id = GroupChannels.ChannelId
+			JOIN Teams ON Teams.Id = Channels.SyncableId
+			JOIN TeamMembers ON TeamMembers.SyncableId = Teams.Id AND TeamMembers.UserId = GroupMembers.UserId
+			FULL JOIN ChannelMemberHistory ON ChannelMemberHistory.ChannelId = GroupChannels.ChannelId AND ChannelMemberHistory.UserId = GroupMembers.UserId
+			WHERE ChannelMemberHistory.UserId IS NULL
+			AND ChannelMemberHistory.LeaveTime IS NULL
+			AND Groups.DeleteAt = 0
+			AND GroupChannels.DeleteAt = 0
+			AND GroupChannels.AutoAdd = true
+			AND GroupMembers.DeleteAt = 0
+			AND (GroupMembers.CreateAt, GroupMembers.UserId, GroupChannels.ChannelId) > (:AfterCreateAt, :AfterUserId, :AfterChannelId)
+			ORDER BY GroupMembers.CreateAt, GroupMembers.UserId, GroupChannels.ChannelId
+			LIMIT :Limit`
+
+	if groupChannelPendingMembersEnabled() {
+		sql = `SELECT UserId, ChannelId, GroupMemberCreateAt
+			FROM GroupChannelPendingMembers
+			WHERE (GroupMemberCreateAt, UserId, ChannelId) > (:AfterCreateAt, :AfterUserId, :AfterChannelId)
+			ORDER BY GroupMemberCreateAt, UserId, ChannelId
+			LIMIT :Limit`
+	}
+
+	var pairs []*model.UserChannelIDPair
+	if _, err := s.GetReplica().Select(&pairs, sql, map[string]interface{}{"AfterCreateAt": afterCreateAt, "AfterUserId": afterUserId, "AfterChannelId": afterChannelId, "Limit": limit}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddChannelMembershipsPage", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = pairs
+
+	return result
+}
+
+// pendingAutoAddChannelMembershipsMaterialized reads straight from GroupChannelPendingMembers,
+// which DB triggers keep in sync with GroupMembers/GroupChannels/ChannelMembers, avoiding the
+// FULL JOIN entirely.
+func (s *SqlSupplier) pendingAutoAddChannelMembershipsMaterialized(minGroupMembersCreateAt int) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	sql := `SELECT UserId, ChannelId
+			FROM GroupChannelPendingMembers
+			WHERE GroupMemberCreateAt >= :MinGroupMembersCreateAt`
+
+	var pairs []*model.UserChannelIDPair
+	if _, err := s.GetReplica().Select(&pairs, sql, map[string]interface{}{"MinGroupMembersCreateAt": minGroupMembersCreateAt}); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingAutoAddChannelMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = pairs
+
+	return result
+}
+
+// PendingRemoveChannelMemberships is the mirror image of PendingAutoAddChannelMemberships: it
+// finds ChannelMembers rows for a channel that is linked with AutoAdd and CanLeave = false to at
+// least one group (i.e. group sync, not the user, owns that membership), where the user is no
+// longer an active member of ANY of the channel's AutoAdd groups. The NOT EXISTS is evaluated
+// across every AutoAdd group linked to the channel, not just one, so a user who still belongs to
+// one of several linked groups is never surfaced here via another group's row. Channel admins and
+// members who were manually added (ChannelMembers.ManuallyAdded, see upgradeChannelMembersManuallyAdded)
+// are excluded, since group sync should only ever remove a membership it created.
+func (s *SqlSupplier) PendingRemoveChannelMemberships(ctx context.Context, hints ...store.LayeredStoreHint) *store.LayeredStoreSupplierResult {
+	result := store.NewSupplierResult()
+
+	sql := `SELECT ChannelMembers.UserId, ChannelMembers.ChannelId
+			FROM ChannelMembers
+			WHERE ChannelMembers.SchemeAdmin = false
+			AND ChannelMembers.ManuallyAdded = false
+			AND EXISTS (
+				SELECT 1
+				FROM GroupChannels
+				JOIN Groups ON Groups.Id = GroupChannels.GroupId
+				WHERE GroupChannels.ChannelId = ChannelMembers.ChannelId
+				AND GroupChannels.DeleteAt = 0
+				AND GroupChannels.AutoAdd = true
+				AND GroupChannels.CanLeave = false
+				AND Groups.DeleteAt = 0
+			)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM GroupMembers
+				JOIN GroupChannels ON GroupChannels.GroupId = GroupMembers.GroupId
+				JOIN Groups ON Groups.Id = GroupMembers.GroupId
+				WHERE GroupChannels.ChannelId = ChannelMembers.ChannelId
+				AND GroupChannels.DeleteAt = 0
+				AND GroupChannels.AutoAdd = true
+				AND Groups.DeleteAt = 0
+				AND GroupMembers.UserId = ChannelMembers.UserId
+				AND GroupMembers.DeleteAt = 0
+			)`
+
+	var pairs []*model.UserChannelIDPair
+	if _, err := s.GetReplica().Select(&pairs, sql, nil); err != nil {
+		result.Err = model.NewAppError("SqlGroupStore.PendingRemoveChannelMemberships", "store.sql_group.select_error", nil, err.Error(), http.StatusInternalServerError)
+		return result
+	}
+
+	result.Data = pairs
 
 	return result
 }
@@ -0,0 +1,41 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+func TestGroupSyncableTableName(t *testing.T) {
+	cases := []struct {
+		name         string
+		syncableType model.GroupSyncableType
+		expectedName string
+		expectError  bool
+	}{
+		{name: "team", syncableType: model.GSTeam, expectedName: "GroupTeams"},
+		{name: "channel", syncableType: model.GSChannel, expectedName: "GroupChannels"},
+		{name: "unsupported", syncableType: model.GroupSyncableType("bogus"), expectError: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			table, err := groupSyncableTableName(c.syncableType)
+			if c.expectError {
+				if err == nil {
+					t.Fatalf("expected an error for syncable type %v, got none", c.syncableType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for syncable type %v: %v", c.syncableType, err)
+			}
+			if table != c.expectedName {
+				t.Fatalf("expected table %q, got %q", c.expectedName, table)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2018-present Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package sqlstore
+
+import (
+	"sync/atomic"
+
+	"github.com/mattermost/mattermost-server/model"
+)
+
+// groupChannelPendingMembersExperimental gates which query path PendingAutoAddChannelMemberships
+// uses: the materialized GroupChannelPendingMembers table, or the original FULL JOIN. The table
+// and its triggers are always provisioned (see initSqlSupplierGroups/upgradeGroupChannelPendingMembersTriggers)
+// so that flipping this at runtime never races against schema setup. It's accessed atomically
+// since it's read from query goroutines and written from whatever calls the setter.
+var groupChannelPendingMembersExperimental int32
+
+// EnableExperimentalGroupChannelPendingMembers turns the materialized-table read path for
+// PendingAutoAddChannelMemberships on or off. It can be flipped without a server restart: the
+// table and triggers backing it are provisioned unconditionally at store startup, so toggling
+// this only changes which query runs.
+func EnableExperimentalGroupChannelPendingMembers(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&groupChannelPendingMembersExperimental, v)
+}
+
+func groupChannelPendingMembersEnabled() bool {
+	return atomic.LoadInt32(&groupChannelPendingMembersExperimental) != 0
+}
+
+// upgradeGroupChannelPendingMembersTriggers installs the DB triggers that keep
+// GroupChannelPendingMembers in sync with GroupMembers, GroupChannels, and ChannelMembers:
+// a pending row is inserted when a user joins a group linked with AutoAdd (or when a
+// GroupChannels row flips AutoAdd false->true), and removed once the user actually joins the
+// channel. It always runs, independent of groupChannelPendingMembersEnabled, so the fallback
+// join-based query and the materialized one never drift out of sync with the schema.
+func upgradeGroupChannelPendingMembersTriggers(sqlStore SqlStore) {
+	if sqlStore.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		upgradeGroupChannelPendingMembersTriggersPostgres(sqlStore)
+	} else {
+		upgradeGroupChannelPendingMembersTriggersMysql(sqlStore)
+	}
+}
+
+// upgradeChannelMembersManuallyAdded provisions ChannelMembers.ManuallyAdded, defaulting existing
+// rows to true (manually added) since they predate group sync tracking this distinction, and
+// installs a trigger that clears it for any inserted row whose (UserId, ChannelId) still has a
+// GroupChannelPendingMembers row, whichever path performs the insert. A BEFORE
+// INSERT trigger is used rather than an AFTER INSERT trigger that UPDATEs ChannelMembers, because
+// MySQL forbids a trigger from modifying the table whose statement invoked it.
+func upgradeChannelMembersManuallyAdded(sqlStore SqlStore) {
+	sqlStore.CreateColumnIfNotExists("ChannelMembers", "ManuallyAdded", "boolean", "boolean", "true")
+
+	if sqlStore.DriverName() == model.DATABASE_DRIVER_POSTGRES {
+		upgradeChannelMembersManuallyAddedPostgres(sqlStore)
+	} else {
+		upgradeChannelMembersManuallyAddedMysql(sqlStore)
+	}
+}
+
+func upgradeChannelMembersManuallyAddedPostgres(sqlStore SqlStore) {
+	sqlStore.GetMaster().Exec(`
+		CREATE OR REPLACE FUNCTION channel_members_manually_added() RETURNS TRIGGER AS $$
+		BEGIN
+			IF EXISTS (
+				SELECT 1 FROM GroupChannelPendingMembers
+				WHERE GroupChannelPendingMembers.UserId = NEW.UserId AND GroupChannelPendingMembers.ChannelId = NEW.ChannelId
+			) THEN
+				NEW.ManuallyAdded = false;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trigger_channel_members_manually_added ON ChannelMembers;
+		CREATE TRIGGER trigger_channel_members_manually_added
+			BEFORE INSERT ON ChannelMembers
+			FOR EACH ROW EXECUTE PROCEDURE channel_members_manually_added();
+	`)
+}
+
+func upgradeChannelMembersManuallyAddedMysql(sqlStore SqlStore) {
+	sqlStore.GetMaster().Exec(`
+		DROP TRIGGER IF EXISTS trigger_channel_members_manually_added;
+		CREATE TRIGGER trigger_channel_members_manually_added
+		BEFORE INSERT ON ChannelMembers
+		FOR EACH ROW
+		SET NEW.ManuallyAdded = NEW.ManuallyAdded AND NOT EXISTS (
+			SELECT 1 FROM GroupChannelPendingMembers
+			WHERE UserId = NEW.UserId AND ChannelId = NEW.ChannelId
+		);
+	`)
+}
+
+func upgradeGroupChannelPendingMembersTriggersPostgres(sqlStore SqlStore) {
+	sqlStore.GetMaster().Exec(`
+		CREATE OR REPLACE FUNCTION group_channel_pending_members_on_group_member() RETURNS TRIGGER AS $$
+		BEGIN
+			INSERT INTO GroupChannelPendingMembers (UserId, ChannelId, GroupMemberCreateAt)
+			SELECT NEW.UserId, GroupChannels.ChannelId, NEW.CreateAt
+			FROM GroupChannels
+			WHERE GroupChannels.GroupId = NEW.GroupId AND GroupChannels.AutoAdd = true AND GroupChannels.DeleteAt = 0
+			ON CONFLICT (UserId, ChannelId) DO NOTHING;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trigger_group_channel_pending_members_on_group_member ON GroupMembers;
+		CREATE TRIGGER trigger_group_channel_pending_members_on_group_member
+			AFTER INSERT ON GroupMembers
+			FOR EACH ROW EXECUTE PROCEDURE group_channel_pending_members_on_group_member();
+
+		CREATE OR REPLACE FUNCTION group_channel_pending_members_on_group_channel_autoadd() RETURNS TRIGGER AS $$
+		BEGIN
+			IF NEW.AutoAdd = true AND (OLD.AutoAdd = false OR OLD.AutoAdd IS NULL) AND NEW.DeleteAt = 0 THEN
+				INSERT INTO GroupChannelPendingMembers (UserId, ChannelId, GroupMemberCreateAt)
+				SELECT GroupMembers.UserId, NEW.ChannelId, GroupMembers.CreateAt
+				FROM GroupMembers
+				WHERE GroupMembers.GroupId = NEW.GroupId AND GroupMembers.DeleteAt = 0
+				ON CONFLICT (UserId, ChannelId) DO NOTHING;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trigger_group_channel_pending_members_on_group_channel_autoadd ON GroupChannels;
+		CREATE TRIGGER trigger_group_channel_pending_members_on_group_channel_autoadd
+			AFTER UPDATE ON GroupChannels
+			FOR EACH ROW EXECUTE PROCEDURE group_channel_pending_members_on_group_channel_autoadd();
+
+		CREATE OR REPLACE FUNCTION group_channel_pending_members_on_channel_member() RETURNS TRIGGER AS $$
+		BEGIN
+			DELETE FROM GroupChannelPendingMembers
+			WHERE GroupChannelPendingMembers.UserId = NEW.UserId AND GroupChannelPendingMembers.ChannelId = NEW.ChannelId;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trigger_group_channel_pending_members_on_channel_member ON ChannelMembers;
+		CREATE TRIGGER trigger_group_channel_pending_members_on_channel_member
+			AFTER INSERT ON ChannelMembers
+			FOR EACH ROW EXECUTE PROCEDURE group_channel_pending_members_on_channel_member();
+	`)
+}
+
+func upgradeGroupChannelPendingMembersTriggersMysql(sqlStore SqlStore) {
+	sqlStore.GetMaster().Exec(`
+		DROP TRIGGER IF EXISTS trigger_group_channel_pending_members_on_group_member;
+		CREATE TRIGGER trigger_group_channel_pending_members_on_group_member
+		AFTER INSERT ON GroupMembers
+		FOR EACH ROW
+		INSERT IGNORE INTO GroupChannelPendingMembers (UserId, ChannelId, GroupMemberCreateAt)
+		SELECT NEW.UserId, GroupChannels.ChannelId, NEW.CreateAt
+		FROM GroupChannels
+		WHERE GroupChannels.GroupId = NEW.GroupId AND GroupChannels.AutoAdd = true AND GroupChannels.DeleteAt = 0;
+	`)
+
+	sqlStore.GetMaster().Exec(`
+		DROP TRIGGER IF EXISTS trigger_group_channel_pending_members_on_group_channel_autoadd;
+		CREATE TRIGGER trigger_group_channel_pending_members_on_group_channel_autoadd
+		AFTER UPDATE ON GroupChannels
+		FOR EACH ROW
+		INSERT IGNORE INTO GroupChannelPendingMembers (UserId, ChannelId, GroupMemberCreateAt)
+		SELECT GroupMembers.UserId, NEW.ChannelId, GroupMembers.CreateAt
+		FROM GroupMembers
+		WHERE NEW.AutoAdd = true AND OLD.AutoAdd = false AND NEW.DeleteAt = 0
+		AND GroupMembers.GroupId = NEW.GroupId AND GroupMembers.DeleteAt = 0;
+	`)
+
+	sqlStore.GetMaster().Exec(`
+		DROP TRIGGER IF EXISTS trigger_group_channel_pending_members_on_channel_member;
+		CREATE TRIGGER trigger_group_channel_pending_members_on_channel_member
+		AFTER INSERT ON ChannelMembers
+		FOR EACH ROW
+		DELETE FROM GroupChannelPendingMembers
+		WHERE UserId = NEW.UserId AND ChannelId = NEW.ChannelId;
+	`)
+}